@@ -0,0 +1,73 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamostream
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+// dbCheckpoint is the position a consumer group has processed up to within a
+// single shard.
+type dbCheckpoint struct {
+	ConsumerGroup string `dynamo:",hash"`
+	ShardID       string `dynamo:",range"`
+
+	SequenceNumber string
+}
+
+// loadCheckpoint returns the last sequence number checkpointed for group's
+// consumption of shardID, or "" if none has been saved yet.
+func (b *EventBus) loadCheckpoint(group, shardID string) (string, error) {
+	var cp dbCheckpoint
+
+	err := b.checkpoints.Get("ConsumerGroup", group).Range("ShardID", dynamo.Equal, shardID).Consistent(true).One(&cp)
+	if err == dynamo.ErrNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return cp.SequenceNumber, nil
+}
+
+// saveCheckpoint records that group has processed shardID up to and
+// including sequenceNumber.
+func (b *EventBus) saveCheckpoint(group, shardID, sequenceNumber string) error {
+	return b.checkpoints.Put(&dbCheckpoint{
+		ConsumerGroup:  group,
+		ShardID:        shardID,
+		SequenceNumber: sequenceNumber,
+	}).Run()
+}
+
+// CreateCheckpointTable creates the checkpoint table if it doesn't already exist.
+func (b *EventBus) CreateCheckpointTable(ctx context.Context) error {
+	if err := b.db.CreateTable(b.config.CheckpointTableName, dbCheckpoint{}).RunWithContext(ctx); err != nil {
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.Code() == "ResourceInUseException" {
+			return nil
+		}
+
+		return err
+	}
+
+	return b.client.WaitUntilTableExistsWithContext(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(b.config.CheckpointTableName),
+	})
+}
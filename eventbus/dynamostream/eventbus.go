@@ -0,0 +1,480 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dynamostream provides an eventhorizon.EventBus that publishes
+// events by tailing the DynamoDB Stream of an eh-dynamo EventStore's events
+// table, instead of requiring a second, separately-committed write. Since
+// EventStore.Save already durably commits every event, a handler that
+// consumes the table's stream is guaranteed to eventually see it: a
+// transactional outbox for free.
+//
+// AddHandler resolves the table to tail from the namespace
+// (github.com/looplab/eventhorizon/namespace) carried by its ctx, the same
+// way EventStore.TableName does, so a handler added once per namespace
+// tails that namespace's own table and its own stream.
+package dynamostream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/guregu/dynamo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+
+	eventstore "github.com/project-longbridge/eh-dynamo"
+)
+
+// ErrStreamNotEnabled is returned when the events table does not have a
+// DynamoDB Stream with an image-bearing view type enabled.
+var ErrStreamNotEnabled = errors.New("events table does not have a usable DynamoDB Stream")
+
+// Config is a config for the DynamoDB Streams event bus.
+type Config struct {
+	// TableName is the events table to tail, normally the same table an
+	// eh-dynamo EventStore writes to. Its DynamoDB Stream must be enabled
+	// with a NEW_IMAGE or NEW_AND_OLD_IMAGES view type. For a namespaced
+	// AddHandler call this is used as a prefix: see AddHandler.
+	TableName string
+	Region    string
+	Endpoint  string
+
+	// CheckpointTableName is the table per-consumer-group, per-shard
+	// sequence number checkpoints are stored in. Defaults to
+	// TableName + "Checkpoints".
+	CheckpointTableName string
+
+	// AppID identifies this application. Combined with a registered
+	// handler's HandlerType it forms that handler's consumer group, so
+	// that each handler added with AddHandler tracks its own position in
+	// the stream independently of every other handler.
+	AppID string
+
+	// PollInterval is how long to wait before the next GetRecords call on
+	// a shard that just returned no records. Defaults to 1 second.
+	PollInterval time.Duration
+
+	// ShardRefreshInterval is how often the shard list is re-read to
+	// notice shards created by a stream resharding split. Defaults to 30
+	// seconds.
+	ShardRefreshInterval time.Duration
+}
+
+func (c *Config) provideDefaults() {
+	if c.TableName == "" {
+		c.TableName = "eventhorizonEvents"
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.CheckpointTableName == "" {
+		c.CheckpointTableName = c.TableName + "Checkpoints"
+	}
+	if c.AppID == "" {
+		c.AppID = "eventhorizon"
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = time.Second
+	}
+	if c.ShardRefreshInterval == 0 {
+		c.ShardRefreshInterval = 30 * time.Second
+	}
+}
+
+// EventBus is an eh.EventBus backed by a DynamoDB Stream.
+type EventBus struct {
+	config *Config
+
+	client      dynamodbiface.DynamoDBAPI
+	streams     dynamodbstreamsiface.DynamoDBStreamsAPI
+	db          *dynamo.DB
+	checkpoints dynamo.Table
+
+	registered   map[registrationKey]struct{}
+	registeredMu sync.RWMutex
+
+	errCh  chan error
+	cctx   context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewEventBus creates a new EventBus, with optional AWS connection settings.
+func NewEventBus(config *Config) (*EventBus, error) {
+	config.provideDefaults()
+
+	awsConfig := &aws.Config{
+		Region:   aws.String(config.Region),
+		Endpoint: aws.String(config.Endpoint),
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client := dynamodb.New(sess)
+	streams := dynamodbstreams.New(sess)
+	db := dynamo.New(sess)
+
+	return NewEventBusWithClients(config, client, streams, db), nil
+}
+
+// NewEventBusWithClients creates a new EventBus with existing clients.
+func NewEventBusWithClients(config *Config, client dynamodbiface.DynamoDBAPI, streams dynamodbstreamsiface.DynamoDBStreamsAPI, db *dynamo.DB) *EventBus {
+	config.provideDefaults()
+
+	cctx, cancel := context.WithCancel(context.Background())
+
+	return &EventBus{
+		config:      config,
+		client:      client,
+		streams:     streams,
+		db:          db,
+		checkpoints: db.Table(config.CheckpointTableName),
+		registered:  map[registrationKey]struct{}{},
+		errCh:       make(chan error, 100),
+		cctx:        cctx,
+		cancel:      cancel,
+	}
+}
+
+// registrationKey identifies one handler's registration on the bus: a
+// handler is free to be added once per namespace, since each namespace
+// tails its own table's stream.
+type registrationKey struct {
+	namespace   string
+	handlerType eh.EventHandlerType
+}
+
+// HandlerType implements the HandlerType method of the eventhorizon.EventHandler interface.
+func (b *EventBus) HandlerType() eh.EventHandlerType {
+	return "eventbus"
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface. Events never reach the bus this way: they are only ever
+// observed by tailing the events table's DynamoDB Stream, since that's what
+// EventStore.Save already commits them to. This method only exists to
+// satisfy eh.EventBus, which embeds eh.EventHandler.
+func (b *EventBus) HandleEvent(ctx context.Context, event eh.Event) error {
+	return nil
+}
+
+// AddHandler implements the AddHandler method of the eventhorizon.EventBus
+// interface. Each handler is consumed by its own goroutine per stream shard
+// and tracks its own checkpointed position, identified by Config.AppID and
+// h.HandlerType(), so handlers added independently do not interfere with
+// each other's delivery.
+//
+// ctx's namespace (compatible with github.com/looplab/eventhorizon/namespace)
+// selects which table's stream is tailed, the same way EventStore.TableName
+// resolves a namespace to its own table: a bare context.Background() tails
+// Config.TableName unchanged, while a namespaced context tails
+// Config.TableName + "_" + namespace. A handler type may be added once per
+// namespace, since each namespace is an independent stream.
+func (b *EventBus) AddHandler(ctx context.Context, m eh.EventMatcher, h eh.EventHandler) error {
+	if m == nil {
+		return eh.ErrMissingMatcher
+	}
+
+	if h == nil {
+		return eh.ErrMissingHandler
+	}
+
+	ns := namespace.FromContext(ctx)
+	table := b.tableName(ns)
+	key := registrationKey{namespace: ns, handlerType: h.HandlerType()}
+
+	b.registeredMu.Lock()
+	defer b.registeredMu.Unlock()
+
+	if _, ok := b.registered[key]; ok {
+		return eh.ErrHandlerAlreadyAdded
+	}
+
+	streamArn, err := b.streamArn(ctx, table)
+	if err != nil {
+		return fmt.Errorf("could not resolve stream for table '%s': %w", table, err)
+	}
+
+	b.registered[key] = struct{}{}
+
+	group := b.config.AppID + "-" + h.HandlerType().String()
+	if ns != namespace.DefaultNamespace {
+		group = b.config.AppID + "-" + ns + "-" + h.HandlerType().String()
+	}
+
+	b.wg.Add(1)
+
+	go b.consumeStream(ctx, streamArn, group, m, h)
+
+	return nil
+}
+
+// tableName returns the events table to tail for ns, mirroring how
+// EventStore.TableName maps a namespace to its own physical table.
+func (b *EventBus) tableName(ns string) string {
+	if ns == namespace.DefaultNamespace {
+		return b.config.TableName
+	}
+
+	return b.config.TableName + "_" + ns
+}
+
+// Errors implements the Errors method of the eventhorizon.EventBus interface.
+func (b *EventBus) Errors() <-chan error {
+	return b.errCh
+}
+
+// Close implements the Close method of the eventhorizon.EventBus interface.
+func (b *EventBus) Close() error {
+	b.cancel()
+	b.wg.Wait()
+
+	return nil
+}
+
+// streamArn returns the ARN of table's DynamoDB Stream.
+func (b *EventBus) streamArn(ctx context.Context, table string) (string, error) {
+	out, err := b.client.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if out.Table.LatestStreamArn == nil {
+		return "", ErrStreamNotEnabled
+	}
+
+	return aws.StringValue(out.Table.LatestStreamArn), nil
+}
+
+// consumeStream keeps the shards of streamArn covered by one goroutine each,
+// periodically re-listing them so that shards created by a resharding split
+// are picked up, until the bus is closed.
+func (b *EventBus) consumeStream(ctx context.Context, streamArn, group string, m eh.EventMatcher, h eh.EventHandler) {
+	defer b.wg.Done()
+
+	watched := map[string]struct{}{}
+
+	ticker := time.NewTicker(b.config.ShardRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		shards, err := b.listShards(streamArn)
+		if err != nil {
+			b.sendErr(&eh.EventBusError{Ctx: ctx, Err: fmt.Errorf("could not list shards: %w", err)})
+		}
+
+		for _, shard := range shards {
+			shardID := aws.StringValue(shard.ShardId)
+			if _, ok := watched[shardID]; ok {
+				continue
+			}
+
+			watched[shardID] = struct{}{}
+
+			b.wg.Add(1)
+
+			go b.consumeShard(ctx, streamArn, shardID, group, m, h)
+		}
+
+		select {
+		case <-b.cctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// listShards returns every shard of streamArn, paging through DescribeStream
+// as needed.
+func (b *EventBus) listShards(streamArn string) ([]*dynamodbstreams.Shard, error) {
+	var shards []*dynamodbstreams.Shard
+
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(streamArn)}
+
+	for {
+		out, err := b.streams.DescribeStream(input)
+		if err != nil {
+			return nil, err
+		}
+
+		shards = append(shards, out.StreamDescription.Shards...)
+
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+
+		input.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// consumeShard polls a single shard for records from its last checkpoint,
+// dispatching matching events to h and checkpointing progress as it goes,
+// until the shard is closed and fully drained, h fails to handle an event,
+// or the bus is closed.
+func (b *EventBus) consumeShard(ctx context.Context, streamArn, shardID, group string, m eh.EventMatcher, h eh.EventHandler) {
+	defer b.wg.Done()
+
+	iterator, err := b.shardIterator(streamArn, shardID, group)
+	if err != nil {
+		b.sendErr(&eh.EventBusError{Ctx: ctx, Err: fmt.Errorf("could not get shard iterator for shard '%s': %w", shardID, err)})
+
+		return
+	}
+
+	for iterator != "" {
+		select {
+		case <-b.cctx.Done():
+			return
+		default:
+		}
+
+		out, err := b.streams.GetRecordsWithContext(b.cctx, &dynamodbstreams.GetRecordsInput{ShardIterator: aws.String(iterator)})
+		if err != nil {
+			if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.Code() == dynamodbstreams.ErrCodeExpiredIteratorException {
+				if iterator, err = b.shardIterator(streamArn, shardID, group); err != nil {
+					b.sendErr(&eh.EventBusError{Ctx: ctx, Err: fmt.Errorf("could not refresh shard iterator for shard '%s': %w", shardID, err)})
+
+					return
+				}
+
+				continue
+			}
+
+			b.sendErr(&eh.EventBusError{Ctx: ctx, Err: fmt.Errorf("could not get records for shard '%s': %w", shardID, err)})
+			time.Sleep(b.config.PollInterval)
+
+			continue
+		}
+
+		for _, record := range out.Records {
+			if !b.handleRecord(ctx, group, shardID, record, m, h) {
+				// Leave the checkpoint before the failed record.
+				return
+			}
+		}
+
+		if out.NextShardIterator == nil {
+			// The shard is closed and has been fully drained.
+			return
+		}
+
+		iterator = aws.StringValue(out.NextShardIterator)
+
+		if len(out.Records) == 0 {
+			select {
+			case <-b.cctx.Done():
+				return
+			case <-time.After(b.config.PollInterval):
+			}
+		}
+	}
+}
+
+// handleRecord decodes a single stream record and, if it matches m, hands it
+// to h before advancing the shard's checkpoint. The checkpoint is only
+// advanced past a record once its event has been handled successfully: when
+// h fails, handleRecord returns false and consumeShard stops consuming the
+// shard, so a failed handler retries the same record from the shard after a
+// restart.
+//
+// REMOVE and MODIFY records are skipped: events are only ever INSERTed by
+// EventStore.Save, so a MODIFY is either a maintenance write (RenameEvent
+// changing EventType, or Replace rewriting a record's data) or Save
+// overwriting the per-aggregate version-counter item, never a new event, and
+// redelivering it would hand handlers an event they have already seen. Event
+// store maintenance operations are for fixing already-delivered history, not
+// for publishing new events.
+func (b *EventBus) handleRecord(ctx context.Context, group, shardID string, record *dynamodbstreams.Record, m eh.EventMatcher, h eh.EventHandler) bool {
+	switch aws.StringValue(record.EventName) {
+	case dynamodbstreams.OperationTypeRemove, dynamodbstreams.OperationTypeModify:
+		return true
+	}
+
+	event, ok, err := eventstore.DecodeStreamRecord(record.Dynamodb.NewImage)
+	if err != nil {
+		b.sendErr(&eh.EventBusError{Ctx: ctx, Err: fmt.Errorf("could not decode stream record: %w", err)})
+
+		return true
+	}
+
+	if ok && m.Match(event) {
+		if err := h.HandleEvent(ctx, event); err != nil {
+			b.sendErr(&eh.EventBusError{Ctx: ctx, Event: event, Err: fmt.Errorf("could not handle event (%s): %w", h.HandlerType(), err)})
+
+			return false
+		}
+	}
+
+	if err := b.saveCheckpoint(group, shardID, aws.StringValue(record.Dynamodb.SequenceNumber)); err != nil {
+		b.sendErr(&eh.EventBusError{Ctx: ctx, Err: fmt.Errorf("could not save checkpoint: %w", err)})
+	}
+
+	return true
+}
+
+// shardIterator returns a shard iterator for group's consumption of shardID,
+// resuming after its last checkpointed sequence number if one exists, or
+// replaying the shard from the beginning otherwise.
+func (b *EventBus) shardIterator(streamArn, shardID, group string) (string, error) {
+	sequenceNumber, err := b.loadCheckpoint(group, shardID)
+	if err != nil {
+		return "", err
+	}
+
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn: aws.String(streamArn),
+		ShardId:   aws.String(shardID),
+	}
+
+	if sequenceNumber != "" {
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeAfterSequenceNumber)
+		input.SequenceNumber = aws.String(sequenceNumber)
+	} else {
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeTrimHorizon)
+	}
+
+	out, err := b.streams.GetShardIterator(input)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.ShardIterator), nil
+}
+
+// sendErr delivers err on the error channel, dropping and logging it if no
+// one is reading, the same backpressure behavior as the other eventhorizon
+// event bus implementations.
+func (b *EventBus) sendErr(err *eh.EventBusError) {
+	select {
+	case b.errCh <- err:
+	default:
+		log.Printf("eh-dynamo: missed error in DynamoDB Streams event bus: %s", err)
+	}
+}
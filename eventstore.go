@@ -18,6 +18,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -28,6 +30,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/guregu/dynamo"
 	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
 )
 
 // ErrCouldNotClearDB is when the database could not be cleared.
@@ -47,6 +50,46 @@ type EventStoreConfig struct {
 	TableName string
 	Region    string
 	Endpoint  string
+
+	// SnapshotTableName is the companion table snapshots are stored in.
+	// Defaults to TableName + "Snapshots".
+	SnapshotTableName string
+	// SnapshotStrategy, if set, is consulted at the end of every Save to
+	// decide whether a new snapshot should be written. Snapshotter must
+	// also be set for snapshots to actually be taken.
+	SnapshotStrategy SnapshotStrategy
+	// Snapshotter produces the raw state stored in a snapshot when
+	// SnapshotStrategy fires.
+	Snapshotter Snapshotter
+
+	// TrackAggregateVersion, if set, maintains a per-aggregate version
+	// counter item that is updated atomically alongside the events in
+	// every Save whose events fit in a single TransactWriteItems call. A
+	// Save that is written in chunks does not update it.
+	TrackAggregateVersion bool
+
+	// ScanSegments controls how many parallel segments Iter splits its
+	// table scan into. Defaults to 1, a plain sequential scan; values
+	// greater than 1 speed up full replays of large event stores at the
+	// cost of that many concurrent Scan workers.
+	ScanSegments int
+
+	// PreCreateTable, if set, is called with the resolved table name the
+	// first time a namespace's table is about to be used, so that
+	// multi-tenant deployments don't have to provision each tenant's table
+	// out of band before its first event. Existence is then cached for the
+	// lifetime of the EventStore, so the hook runs at most once per
+	// namespace.
+	PreCreateTable func(ctx context.Context, tableName string) error
+
+	// RenameCheckpointTableName is the companion table RenameEvent persists
+	// its per-segment scan cursor to. Defaults to TableName +
+	// "RenameCheckpoints".
+	RenameCheckpointTableName string
+	// RenameProgress, if set, is called after every batch of renamed events
+	// RenameEvent commits, reporting cumulative counts across all segments
+	// of the rename so far.
+	RenameProgress func(ctx context.Context, from, to eh.EventType, scanned, renamed int)
 }
 
 func (c *EventStoreConfig) provideDefaults() {
@@ -56,12 +99,20 @@ func (c *EventStoreConfig) provideDefaults() {
 	if c.Region == "" {
 		c.Region = "us-east-1"
 	}
+	if c.ScanSegments == 0 {
+		c.ScanSegments = 1
+	}
 }
 
 // EventStore implements an EventStore for DynamoDB.
 type EventStore struct {
 	service *dynamo.DB
 	config  *EventStoreConfig
+
+	// tables caches the names of namespace tables PreCreateTable has
+	// already run for, so it runs at most once per namespace.
+	tables   map[string]struct{}
+	tablesMu sync.RWMutex
 }
 
 // NewEventStore creates a new EventStore.
@@ -86,6 +137,7 @@ func NewEventStoreWithDB(config *EventStoreConfig, db *dynamo.DB) *EventStore {
 	s := &EventStore{
 		service: db,
 		config:  config,
+		tables:  map[string]struct{}{},
 	}
 
 	return s
@@ -95,7 +147,42 @@ func (s *EventStore) Close() error {
 	return nil
 }
 
+// ensureTable returns the dynamo.Table to use for ctx's namespace, running
+// EventStoreConfig.PreCreateTable the first time that namespace's table is
+// needed. Results are cached for the lifetime of the EventStore so the hook
+// runs at most once per namespace.
+func (s *EventStore) ensureTable(ctx context.Context) (dynamo.Table, error) {
+	name := s.TableName(ctx)
+
+	s.tablesMu.RLock()
+	_, ok := s.tables[name]
+	s.tablesMu.RUnlock()
+
+	if ok || s.config.PreCreateTable == nil {
+		return s.service.Table(name), nil
+	}
+
+	s.tablesMu.Lock()
+	defer s.tablesMu.Unlock()
+
+	if _, ok := s.tables[name]; !ok {
+		if err := s.config.PreCreateTable(ctx, name); err != nil {
+			return dynamo.Table{}, fmt.Errorf("could not pre-create table '%s': %w", name, err)
+		}
+
+		s.tables[name] = struct{}{}
+	}
+
+	return s.service.Table(name), nil
+}
+
 // Save implements the Save method of the eventhorizon.EventStore interface.
+//
+// All events are written in a single DynamoDB TransactWriteItems call so
+// that a Save either commits in full or leaves no trace, closing the torn
+// writes that were possible with the previous per-event Put loop. Batches
+// that exceed the TransactWriteItems limits (25 items, 4MB) fall back to a
+// chunked, non-atomic write.
 func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
 	if len(events) == 0 {
 		return &eh.EventStoreError{
@@ -110,8 +197,21 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 	// original aggregate version.
 	aggregateID := events[0].AggregateID()
 	version := originalVersion
-	table := s.service.Table(s.TableName(ctx))
-	for _, event := range events {
+
+	table, err := s.ensureTable(ctx)
+	if err != nil {
+		return &eh.EventStoreError{
+			Err:              err,
+			Op:               eh.EventStoreOpSave,
+			AggregateType:    at,
+			AggregateID:      id,
+			AggregateVersion: originalVersion,
+			Events:           events,
+		}
+	}
+
+	dbEvents := make([]*dbEvent, len(events))
+	for i, event := range events {
 		// Only accept events belonging to the same aggregate.
 		if event.AggregateID() != aggregateID {
 			return &eh.EventStoreError{
@@ -143,41 +243,185 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 		}
 		version++
 
-		// TODO: Implement atomic version counter for the aggregate.
-		// TODO: Batch write all events.
-		// TODO: Support translating not found to not be an error but an
-		// empty list.
-		if err := table.Put(e).If("attribute_not_exists(AggregateID) AND attribute_not_exists(Version)").Run(); err != nil {
-			if err, ok := err.(awserr.RequestFailure); ok && err.Code() == "ConditionalCheckFailedException" {
-				return &eh.EventStoreError{
-					Err:              ErrCouldNotSaveAggregate,
-					Op:               eh.EventStoreOpSave,
-					AggregateType:    at,
-					AggregateID:      id,
-					AggregateVersion: originalVersion,
-					Events:           events,
-				}
-			}
-			return &eh.EventStoreError{
-				Err:              err,
-				Op:               eh.EventStoreOpSave,
-				AggregateType:    at,
-				AggregateID:      id,
-				AggregateVersion: originalVersion,
-				Events:           events,
-			}
+		dbEvents[i] = e
+	}
+
+	// TODO: Support translating not found to not be an error but an
+	// empty list.
+	if err := s.writeEvents(ctx, table, dbEvents, id, originalVersion, version); err != nil {
+		return &eh.EventStoreError{
+			Err:              err,
+			Op:               eh.EventStoreOpSave,
+			AggregateType:    at,
+			AggregateID:      id,
+			AggregateVersion: originalVersion,
+			Events:           events,
 		}
 	}
 
+	s.maybeSnapshot(ctx, at, id, version)
+
 	return nil
 }
 
+// maxTransactWriteItems is the DynamoDB TransactWriteItems limit on the
+// number of items per transaction.
+const maxTransactWriteItems = 25
+
+// maxTransactWriteBytes is the DynamoDB TransactWriteItems limit on the
+// total size of all items per transaction.
+const maxTransactWriteBytes = 4 * 1024 * 1024
+
+// writeEvents commits dbEvents for aggregateID in a single TransactWriteItems
+// call, including an atomic update of the aggregate's version-counter item
+// when EventStoreConfig.TrackAggregateVersion is set. If the batch exceeds
+// the TransactWriteItems limits it is instead written in chunks, which
+// trades the all-or-nothing guarantee for the ability to save large
+// batches; the version-counter item is only updated when everything fits in
+// a single transaction, since it can't be kept consistent across multiple
+// independently-committed chunks.
+func (s *EventStore) writeEvents(ctx context.Context, table dynamo.Table, dbEvents []*dbEvent, aggregateID uuid.UUID, originalVersion, newVersion int) error {
+	if fitsInOneTransaction(dbEvents) {
+		tx := s.service.WriteTx()
+		for _, e := range dbEvents {
+			tx.Put(table.Put(e).If("attribute_not_exists(AggregateID) AND attribute_not_exists(Version)"))
+		}
+
+		if s.config.TrackAggregateVersion {
+			tx.Put(table.Put(&dbAggregateVersion{
+				AggregateID:    aggregateID,
+				Version:        aggregateVersionRangeKey,
+				CurrentVersion: newVersion,
+			}).If("attribute_not_exists(CurrentVersion) OR CurrentVersion = ?", originalVersion))
+		}
+
+		if err := tx.RunWithContext(ctx); err != nil {
+			return translateTransactWriteError(err)
+		}
+
+		return nil
+	}
+
+	for _, chunk := range chunkDBEvents(dbEvents, maxTransactWriteItems) {
+		tx := s.service.WriteTx()
+		for _, e := range chunk {
+			tx.Put(table.Put(e).If("attribute_not_exists(AggregateID) AND attribute_not_exists(Version)"))
+		}
+
+		if err := tx.RunWithContext(ctx); err != nil {
+			return translateTransactWriteError(err)
+		}
+	}
+
+	return nil
+}
+
+// fitsInOneTransaction reports whether dbEvents can be written in a single
+// TransactWriteItems call.
+func fitsInOneTransaction(dbEvents []*dbEvent) bool {
+	if len(dbEvents) > maxTransactWriteItems {
+		return false
+	}
+
+	var size int
+	for _, e := range dbEvents {
+		size += estimatedDBEventSize(e)
+	}
+
+	return size <= maxTransactWriteBytes
+}
+
+// chunkDBEvents splits dbEvents into groups of at most n items.
+func chunkDBEvents(dbEvents []*dbEvent, n int) [][]*dbEvent {
+	var chunks [][]*dbEvent
+	for n < len(dbEvents) {
+		dbEvents, chunks = dbEvents[n:], append(chunks, dbEvents[:n:n])
+	}
+
+	return append(chunks, dbEvents)
+}
+
+// estimatedDBEventSize approximates the marshaled DynamoDB item size of e,
+// used only to decide whether a batch needs to be chunked.
+func estimatedDBEventSize(e *dbEvent) int {
+	av, err := dynamodbattribute.MarshalMap(e)
+	if err != nil {
+		return 0
+	}
+
+	var size int
+	for name, val := range av {
+		size += len(name) + len(val.String())
+	}
+
+	return size
+}
+
+// translateTransactWriteError maps a TransactWriteItems failure to the
+// eventhorizon sentinel errors callers expect. DynamoDB reports conflicting
+// conditional checks as a TransactionCanceledException whose message
+// enumerates a cancellation reason per item; this SDK version doesn't
+// surface those reasons as a structured type, so they're matched in the
+// message text instead.
+func translateTransactWriteError(err error) error {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		switch reqErr.Code() {
+		case "TransactionCanceledException":
+			if strings.Contains(reqErr.Message(), "ConditionalCheckFailed") {
+				return eh.ErrEventConflictFromOtherSave
+			}
+			return ErrCouldNotSaveAggregate
+		case "ConditionalCheckFailedException":
+			return ErrCouldNotSaveAggregate
+		}
+	}
+
+	return err
+}
+
 // Load implements the Load method of the eventhorizon.EventStore interface.
 func (s *EventStore) Load(ctx context.Context, id uuid.UUID) ([]eh.Event, error) {
-	table := s.service.Table(s.TableName(ctx))
+	table, err := s.ensureTable(ctx)
+	if err != nil {
+		return nil, &eh.EventStoreError{
+			Err:         err,
+			Op:          eh.EventStoreOpLoad,
+			AggregateID: id,
+		}
+	}
 
 	var dbEvents []dbEvent
-	err := table.Get("AggregateID", id.String()).Consistent(true).All(&dbEvents)
+	err = table.Get("AggregateID", id.String()).Consistent(true).All(&dbEvents)
+	if err, ok := err.(awserr.RequestFailure); ok && err.Code() == "ResourceNotFoundException" {
+		return []eh.Event{}, nil
+	} else if err != nil {
+		return nil, &eh.EventStoreError{
+			Err:         err,
+			Op:          eh.EventStoreOpLoad,
+			AggregateID: id,
+		}
+	}
+
+	return s.buildEvents(ctx, dbEvents)
+}
+
+// LoadFrom loads the events for the aggregate id starting at fromVersion
+// (inclusive). It queries with a range key lower bound instead of Load's
+// "load everything for this aggregate", so snapshot-based rehydration and
+// projection catch-up don't pay to scan history that would only be
+// discarded client-side.
+func (s *EventStore) LoadFrom(ctx context.Context, id uuid.UUID, fromVersion int) ([]eh.Event, error) {
+	table, err := s.ensureTable(ctx)
+	if err != nil {
+		return nil, &eh.EventStoreError{
+			Err:         err,
+			Op:          eh.EventStoreOpLoad,
+			AggregateID: id,
+		}
+	}
+
+	var dbEvents []dbEvent
+	err = table.Get("AggregateID", id.String()).Range("Version", dynamo.GreaterOrEqual, fromVersion).Consistent(true).All(&dbEvents)
 	if err, ok := err.(awserr.RequestFailure); ok && err.Code() == "ResourceNotFoundException" {
 		return []eh.Event{}, nil
 	} else if err != nil {
@@ -193,10 +437,16 @@ func (s *EventStore) Load(ctx context.Context, id uuid.UUID) ([]eh.Event, error)
 
 // LoadAll will load all the events from the event store (useful to replay events)
 func (s *EventStore) LoadAll(ctx context.Context) ([]eh.Event, error) {
-	table := s.service.Table(s.TableName(ctx))
+	table, err := s.ensureTable(ctx)
+	if err != nil {
+		return nil, &eh.EventStoreError{
+			Err: err,
+			Op:  eh.EventStoreOpLoad,
+		}
+	}
 
 	var dbEvents []dbEvent
-	err := table.Scan().Consistent(true).All(&dbEvents)
+	err = table.Scan().Consistent(true).All(&dbEvents)
 	if err != nil {
 		return nil, &eh.EventStoreError{
 			Err: err,
@@ -207,33 +457,88 @@ func (s *EventStore) LoadAll(ctx context.Context) ([]eh.Event, error) {
 	return s.buildEvents(ctx, dbEvents)
 }
 
+// buildEvents decodes dbEvents into eh.Events, the single choke point for
+// Load, LoadFrom and LoadAll. It skips the per-aggregate version-counter item
+// written alongside an aggregate's events when
+// EventStoreConfig.TrackAggregateVersion is enabled, the same sentinel
+// iterator.go and DecodeStreamRecord already filter out, so it never
+// surfaces as a phantom event.
 func (s *EventStore) buildEvents(ctx context.Context, dbEvents []dbEvent) ([]eh.Event, error) {
-	events := make([]eh.Event, len(dbEvents))
-	for i, dbEvent := range dbEvents {
-		// Create an event of the correct type.
-		if data, err := eh.CreateEventData(dbEvent.EventType); err == nil {
-			// Manually decode the raw event.
-			if err := dynamodbattribute.UnmarshalMap(dbEvent.RawData, data); err != nil {
-				return nil, &eh.EventStoreError{
-					Err: ErrCouldNotUnmarshalEvent,
-					Op:  eh.EventStoreOpLoad,
-				}
-			}
+	events := make([]eh.Event, 0, len(dbEvents))
+	for _, dbEvent := range dbEvents {
+		if dbEvent.Version == aggregateVersionRangeKey {
+			continue
+		}
 
-			// Set concrete event and zero out the decoded event.
-			dbEvent.data = data
-			dbEvent.RawData = nil
+		ev, err := decodeDBEvent(dbEvent)
+		if err != nil {
+			return nil, err
 		}
 
-		events[i] = event{dbEvent: dbEvent}
+		events = append(events, ev)
 	}
 
 	return events, nil
 }
 
+// decodeDBEvent materializes a dbEvent's concrete EventData from its raw,
+// marshaled form, returning the resulting eh.Event.
+func decodeDBEvent(e dbEvent) (eh.Event, error) {
+	// Create an event of the correct type.
+	if data, err := eh.CreateEventData(e.EventType); err == nil {
+		// Manually decode the raw event.
+		if err := dynamodbattribute.UnmarshalMap(e.RawData, data); err != nil {
+			return nil, &eh.EventStoreError{
+				Err: ErrCouldNotUnmarshalEvent,
+				Op:  eh.EventStoreOpLoad,
+			}
+		}
+
+		// Set concrete event and zero out the decoded event.
+		e.data = data
+		e.RawData = nil
+	}
+
+	return event{dbEvent: e}, nil
+}
+
+// DecodeStreamRecord decodes a raw item image from the events table (for
+// example a DynamoDB Streams record's NewImage) into an eh.Event. ok is
+// false for items in the table that aren't events, such as the optional
+// per-aggregate version-counter item written when
+// EventStoreConfig.TrackAggregateVersion is enabled; callers that consume
+// the table's stream directly, like eventbus/dynamostream, use this to
+// recognize and skip them.
+func DecodeStreamRecord(item map[string]*dynamodb.AttributeValue) (ev eh.Event, ok bool, err error) {
+	var e dbEvent
+	if err := dynamodbattribute.UnmarshalMap(item, &e); err != nil {
+		return nil, false, &eh.EventStoreError{
+			Err: ErrCouldNotUnmarshalEvent,
+			Op:  eh.EventStoreOpLoad,
+		}
+	}
+
+	if e.Version == aggregateVersionRangeKey {
+		return nil, false, nil
+	}
+
+	ev, err = decodeDBEvent(e)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return ev, true, nil
+}
+
 // Replace implements the Replace method of the eventhorizon.EventStore interface.
 func (s *EventStore) Replace(ctx context.Context, event eh.Event) error {
-	table := s.service.Table(s.TableName(ctx))
+	table, err := s.ensureTable(ctx)
+	if err != nil {
+		return &eh.EventStoreError{
+			Err: err,
+			Op:  eh.EventStoreOpReplace,
+		}
+	}
 
 	count, err := table.Get("AggregateID", event.AggregateID().String()).Consistent(true).Count()
 	if err != nil {
@@ -264,50 +569,67 @@ func (s *EventStore) Replace(ctx context.Context, event eh.Event) error {
 	return nil
 }
 
-// RenameEvent implements the RenameEvent method of the eventhorizon.EventStore interface.
-func (s *EventStore) RenameEvent(ctx context.Context, from, to eh.EventType) error {
-	table := s.service.Table(s.TableName(ctx))
+// CreateTable creates the table if it is not already existing and correct.
+//
+// The events table is created with its DynamoDB Stream enabled (NEW_IMAGE
+// view), so that eventbus/dynamostream can tail it without any extra setup.
+func (s *EventStore) CreateTable(ctx context.Context) error {
+	if err := s.service.CreateTable(s.TableName(ctx), dbEvent{}).Stream(dynamo.NewImageView).Run(); err != nil {
+		return err
+	}
 
-	var dbEvents []dbEvent
-	err := table.Scan().Filter("EventType = ?", from).Consistent(true).All(&dbEvents)
-	if err != nil {
-		return &eh.EventStoreError{
-			Err: err,
-		}
+	describeParams := &dynamodb.DescribeTableInput{
+		TableName: aws.String(s.TableName(ctx)),
+	}
+	if err := s.service.Client().WaitUntilTableExists(describeParams); err != nil {
+		return err
 	}
 
-	for _, dbEvent := range dbEvents {
-		if err := table.Update("AggregateID", dbEvent.AggregateID).Range("Version", dbEvent.Version).If("EventType = ?", from).Set("EventType", to).Run(); err != nil {
-			return &eh.EventStoreError{
-				Err: err,
-			}
-		}
+	if err := s.service.CreateTable(s.snapshotTableName(ctx), dbSnapshot{}).Run(); err != nil {
+		return err
 	}
 
-	return nil
-}
+	describeSnapshotParams := &dynamodb.DescribeTableInput{
+		TableName: aws.String(s.snapshotTableName(ctx)),
+	}
+	if err := s.service.Client().WaitUntilTableExists(describeSnapshotParams); err != nil {
+		return err
+	}
 
-// CreateTable creates the table if it is not already existing and correct.
-func (s *EventStore) CreateTable(ctx context.Context) error {
-	if err := s.service.CreateTable(s.TableName(ctx), dbEvent{}).Run(); err != nil {
+	if err := s.service.CreateTable(s.renameCheckpointTableName(ctx), dbRenameCheckpoint{}).Run(); err != nil {
 		return err
 	}
 
-	describeParams := &dynamodb.DescribeTableInput{
-		TableName: aws.String(s.TableName(ctx)),
+	describeCheckpointParams := &dynamodb.DescribeTableInput{
+		TableName: aws.String(s.renameCheckpointTableName(ctx)),
 	}
-	if err := s.service.Client().WaitUntilTableExists(describeParams); err != nil {
+	if err := s.service.Client().WaitUntilTableExists(describeCheckpointParams); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// DeleteTable deletes the event table.
+// DeleteTable deletes the event table and its companion snapshot and rename
+// checkpoint tables. Each of the three is deleted independently: one
+// already being gone doesn't stop an attempt to delete the others, so a
+// partially torn-down namespace (for example from a prior DeleteTable call
+// that failed partway through) doesn't leak the remaining tables.
 func (s *EventStore) DeleteTable(ctx context.Context) error {
-	table := s.service.Table(s.TableName(ctx))
-	err := table.DeleteTable().Run()
-	if err != nil {
+	var firstErr error
+	for _, name := range []string{s.TableName(ctx), s.snapshotTableName(ctx), s.renameCheckpointTableName(ctx)} {
+		if err := s.deleteTableIfExists(name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// deleteTableIfExists deletes the named table, treating it already not
+// existing as success.
+func (s *EventStore) deleteTableIfExists(name string) error {
+	if err := s.service.Table(name).DeleteTable().Run(); err != nil {
 		if err, ok := err.(awserr.RequestFailure); ok && err.Code() == "ResourceNotFoundException" {
 			return nil
 		}
@@ -315,7 +637,7 @@ func (s *EventStore) DeleteTable(ctx context.Context) error {
 	}
 
 	describeParams := &dynamodb.DescribeTableInput{
-		TableName: aws.String(s.TableName(ctx)),
+		TableName: aws.String(name),
 	}
 	if err := s.service.Client().WaitUntilTableNotExists(describeParams); err != nil {
 		return err
@@ -324,10 +646,19 @@ func (s *EventStore) DeleteTable(ctx context.Context) error {
 	return nil
 }
 
-// TableName appends the namespace, if one is set, to the table prefix to
-// get the name of the table to use.
+// TableName appends the namespace found in ctx, if one other than
+// namespace.DefaultNamespace is set, to the table prefix to get the name of
+// the table to use. ctx is compatible with
+// github.com/looplab/eventhorizon/namespace: a bare context.Background()
+// resolves to config.TableName unchanged, so existing single-tenant
+// deployments are unaffected.
 func (s *EventStore) TableName(ctx context.Context) string {
-	return s.config.TableName
+	ns := namespace.FromContext(ctx)
+	if ns == namespace.DefaultNamespace {
+		return s.config.TableName
+	}
+
+	return s.config.TableName + "_" + ns
 }
 
 // dbEvent is the internal event record for the DynamoDB event store used
@@ -344,6 +675,21 @@ type dbEvent struct {
 	Metadata      map[string]interface{}
 }
 
+// aggregateVersionRangeKey is the reserved Version value used to store the
+// per-aggregate version-counter item alongside its events. Real events
+// always start at version 1, so 0 can't collide with one.
+const aggregateVersionRangeKey = 0
+
+// dbAggregateVersion is the optional per-aggregate version-counter record,
+// updated atomically with its aggregate's events when
+// EventStoreConfig.TrackAggregateVersion is enabled.
+type dbAggregateVersion struct {
+	AggregateID uuid.UUID `dynamo:",hash"`
+	Version     int       `dynamo:",range"`
+
+	CurrentVersion int
+}
+
 // newDBEvent returns a new dbEvent for an event.
 func newDBEvent(ctx context.Context, event eh.Event) (*dbEvent, error) {
 	// Marshal event data if there is any.
@@ -0,0 +1,358 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore"
+)
+
+// TestEventStoreIntegration runs the shared eventhorizon acceptance suite
+// against a real DynamoDB Local instance.
+func TestEventStoreIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:8000"
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	table := "test-events-" + hex.EncodeToString(b)
+
+	store, err := NewEventStore(&EventStoreConfig{
+		TableName: table,
+		Region:    "us-east-1",
+		Endpoint:  endpoint,
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	defer func() {
+		if err := store.DeleteTable(ctx); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}()
+
+	eventstore.AcceptanceTest(t, store, ctx)
+
+	if err := store.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+// TestTrackAggregateVersionIntegration enables EventStoreConfig.
+// TrackAggregateVersion and confirms the per-aggregate version-counter item
+// Save writes alongside the real events never surfaces as a phantom event
+// from Load or LoadAll.
+func TestTrackAggregateVersionIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:8000"
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	table := "test-events-" + hex.EncodeToString(b)
+
+	store, err := NewEventStore(&EventStoreConfig{
+		TableName:             table,
+		Region:                "us-east-1",
+		Endpoint:              endpoint,
+		TrackAggregateVersion: true,
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	defer func() {
+		if err := store.DeleteTable(ctx); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}()
+
+	id := uuid.New()
+	events := []eh.Event{
+		eh.NewEvent(eh.EventType("Event"), nil, time.Now(), eh.ForAggregate(eh.AggregateType("Aggregate"), id, 1)),
+		eh.NewEvent(eh.EventType("Event"), nil, time.Now(), eh.ForAggregate(eh.AggregateType("Aggregate"), id, 2)),
+	}
+
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	loaded, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if len(loaded) != len(events) {
+		t.Fatalf("Load returned %d events, want %d (version-counter item leaked in as a phantom event?)", len(loaded), len(events))
+	}
+
+	for _, ev := range loaded {
+		if ev.Version() == aggregateVersionRangeKey {
+			t.Errorf("Load returned the version-counter item as an event: %v", ev)
+		}
+	}
+
+	all, err := store.LoadAll(ctx)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	for _, ev := range all {
+		if ev.Version() == aggregateVersionRangeKey {
+			t.Errorf("LoadAll returned the version-counter item as an event: %v", ev)
+		}
+	}
+}
+
+// TestBuildEventsSkipsAggregateVersionItem is the fast, no-network unit test
+// for the same guarantee: buildEvents must filter out the version-counter
+// sentinel row regardless of where the raw dbEvents came from.
+func TestBuildEventsSkipsAggregateVersionItem(t *testing.T) {
+	s := &EventStore{}
+
+	id := uuid.New()
+	dbEvents := []dbEvent{
+		{AggregateID: id, Version: aggregateVersionRangeKey, EventType: eh.EventType("")},
+		{AggregateID: id, Version: 1, EventType: eh.EventType("Event")},
+		{AggregateID: id, Version: 2, EventType: eh.EventType("Event")},
+	}
+
+	events, err := s.buildEvents(context.Background(), dbEvents)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2 (the version-counter item should have been filtered out)", len(events))
+	}
+
+	for _, ev := range events {
+		if ev.Version() == aggregateVersionRangeKey {
+			t.Errorf("buildEvents returned the version-counter item as an event: %v", ev)
+		}
+	}
+}
+
+// fakeDeleteTableClient answers DeleteTableWithContext with ok for every
+// table except those listed in notFound, which it reports as already gone,
+// and WaitUntilTableNotExists with an immediate success, so DeleteTable's
+// control flow can be tested without a real DynamoDB.
+type fakeDeleteTableClient struct {
+	dynamodbiface.DynamoDBAPI
+
+	notFound map[string]bool
+	deleted  []string
+}
+
+func (f *fakeDeleteTableClient) DeleteTableWithContext(_ aws.Context, in *dynamodb.DeleteTableInput, _ ...request.Option) (*dynamodb.DeleteTableOutput, error) {
+	name := aws.StringValue(in.TableName)
+	f.deleted = append(f.deleted, name)
+
+	if f.notFound[name] {
+		return nil, awserr.NewRequestFailure(awserr.New("ResourceNotFoundException", "no such table", nil), 400, "req-1")
+	}
+
+	return &dynamodb.DeleteTableOutput{}, nil
+}
+
+func (f *fakeDeleteTableClient) WaitUntilTableNotExists(*dynamodb.DescribeTableInput) error {
+	return nil
+}
+
+// TestDeleteTableContinuesPastNotFound verifies that DeleteTable attempts
+// all three of its tables even when an earlier one no longer exists,
+// instead of returning early and leaking the rest.
+func TestDeleteTableContinuesPastNotFound(t *testing.T) {
+	fake := &fakeDeleteTableClient{notFound: map[string]bool{"events": true}}
+
+	s := NewEventStoreWithDB(&EventStoreConfig{TableName: "events"}, dynamo.NewFromIface(fake))
+
+	if err := s.DeleteTable(context.Background()); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	want := []string{"events", "eventsSnapshots", "eventsRenameCheckpoints"}
+	if len(fake.deleted) != len(want) {
+		t.Fatalf("DeleteTable attempted to delete %v, want %v", fake.deleted, want)
+	}
+
+	for i, name := range want {
+		if fake.deleted[i] != name {
+			t.Errorf("delete %d: got table %q, want %q", i, fake.deleted[i], name)
+		}
+	}
+}
+
+func TestFitsInOneTransaction(t *testing.T) {
+	small := make([]*dbEvent, 3)
+	for i := range small {
+		small[i] = &dbEvent{EventType: eh.EventType("Event"), Version: i + 1}
+	}
+
+	if !fitsInOneTransaction(small) {
+		t.Error("a handful of small events should fit in one transaction")
+	}
+
+	tooMany := make([]*dbEvent, maxTransactWriteItems+1)
+	for i := range tooMany {
+		tooMany[i] = &dbEvent{EventType: eh.EventType("Event"), Version: i + 1}
+	}
+
+	if fitsInOneTransaction(tooMany) {
+		t.Error("more than maxTransactWriteItems events should not fit in one transaction")
+	}
+
+	tooBig := []*dbEvent{{
+		EventType: eh.EventType("Event"),
+		Version:   1,
+		RawData: map[string]*dynamodb.AttributeValue{
+			"Content": {S: aws.String(strings.Repeat("x", maxTransactWriteBytes))},
+		},
+	}}
+
+	if fitsInOneTransaction(tooBig) {
+		t.Error("an event estimated over maxTransactWriteBytes should not fit in one transaction")
+	}
+}
+
+func TestChunkDBEvents(t *testing.T) {
+	events := make([]*dbEvent, 7)
+	for i := range events {
+		events[i] = &dbEvent{Version: i + 1}
+	}
+
+	chunks := chunkDBEvents(events, 3)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+
+	wantLens := []int{3, 3, 1}
+	for i, chunk := range chunks {
+		if len(chunk) != wantLens[i] {
+			t.Errorf("chunk %d has %d events, want %d", i, len(chunk), wantLens[i])
+		}
+	}
+
+	var flattened []*dbEvent
+	for _, chunk := range chunks {
+		flattened = append(flattened, chunk...)
+	}
+
+	for i, e := range flattened {
+		if e.Version != events[i].Version {
+			t.Errorf("chunking reordered events: got version %d at position %d, want %d", e.Version, i, events[i].Version)
+		}
+	}
+}
+
+func TestChunkDBEventsFitsInOneChunk(t *testing.T) {
+	events := make([]*dbEvent, 2)
+	for i := range events {
+		events[i] = &dbEvent{Version: i + 1}
+	}
+
+	chunks := chunkDBEvents(events, maxTransactWriteItems)
+	if len(chunks) != 1 {
+		t.Fatalf("got %d chunks, want 1", len(chunks))
+	}
+
+	if len(chunks[0]) != 2 {
+		t.Errorf("got %d events in the single chunk, want 2", len(chunks[0]))
+	}
+}
+
+func TestTranslateTransactWriteError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "conditional check failure in a transaction",
+			err:  awserr.NewRequestFailure(awserr.New("TransactionCanceledException", "ConditionalCheckFailed", nil), 400, "req-1"),
+			want: eh.ErrEventConflictFromOtherSave,
+		},
+		{
+			name: "other transaction cancellation reason",
+			err:  awserr.NewRequestFailure(awserr.New("TransactionCanceledException", "ValidationError", nil), 400, "req-2"),
+			want: ErrCouldNotSaveAggregate,
+		},
+		{
+			name: "conditional check failure outside a transaction",
+			err:  awserr.NewRequestFailure(awserr.New("ConditionalCheckFailedException", "The conditional request failed", nil), 400, "req-3"),
+			want: ErrCouldNotSaveAggregate,
+		},
+		{
+			name: "unrelated error is passed through unchanged",
+			err:  errors.New("boom"),
+			want: errors.New("boom"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := translateTransactWriteError(c.err)
+			if got.Error() != c.want.Error() {
+				t.Errorf("translateTransactWriteError(%v) = %v, want %v", c.err, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/guregu/dynamo"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// EventIterator streams events one at a time, paging through the
+// underlying DynamoDB Scan lazily instead of buffering the whole table in
+// memory the way LoadAll does.
+type EventIterator interface {
+	// Next advances the iterator to the next event and reports whether one
+	// is available. It returns false once the iterator is exhausted or an
+	// error occurs; callers must check Err to tell the two apart.
+	Next(ctx context.Context) bool
+
+	// Event returns the event most recently advanced to by Next.
+	Event() eh.Event
+
+	// Err returns the first error encountered while iterating, if any.
+	Err() error
+
+	// Close releases resources held by the iterator. It is safe to call
+	// even if the iterator was not fully drained.
+	Close() error
+}
+
+// Iter returns an EventIterator over every event in the store. If
+// EventStoreConfig.ScanSegments is greater than 1, the table is scanned in
+// that many parallel segments merged into a single iterator, trading
+// strict ordering across aggregates for faster replay of large event
+// stores.
+func (s *EventStore) Iter(ctx context.Context) (EventIterator, error) {
+	table, err := s.ensureTable(ctx)
+	if err != nil {
+		return nil, &eh.EventStoreError{
+			Err: err,
+			Op:  eh.EventStoreOpLoad,
+		}
+	}
+
+	if s.config.ScanSegments <= 1 {
+		iter := table.Scan().Consistent(true).Iter()
+
+		return &singleSegmentIterator{iter: iter}, nil
+	}
+
+	return s.iterSegmented(ctx, s.config.ScanSegments), nil
+}
+
+// singleSegmentIterator adapts a dynamo.PagingIter, which already pages
+// lazily via LastEvaluatedKey, into an EventIterator.
+type singleSegmentIterator struct {
+	iter  dynamo.PagingIter
+	event eh.Event
+	err   error
+}
+
+func (it *singleSegmentIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	for {
+		var e dbEvent
+		if !it.iter.NextWithContext(ctx, &e) {
+			it.err = it.iter.Err()
+
+			return false
+		}
+
+		if e.Version == aggregateVersionRangeKey {
+			continue
+		}
+
+		ev, err := decodeDBEvent(e)
+		if err != nil {
+			it.err = err
+
+			return false
+		}
+
+		it.event = ev
+
+		return true
+	}
+}
+
+func (it *singleSegmentIterator) Event() eh.Event { return it.event }
+func (it *singleSegmentIterator) Err() error      { return it.err }
+func (it *singleSegmentIterator) Close() error    { return nil }
+
+// iterSegmented scans the table in n parallel segments, fanning the
+// decoded events of every segment into one channel. The guregu/dynamo
+// Scan builder has no segmented-scan support, so segments are read with
+// the raw AWS SDK client instead.
+func (s *EventStore) iterSegmented(ctx context.Context, n int) EventIterator {
+	ctx, cancel := context.WithCancel(ctx)
+
+	events := make(chan eh.Event)
+	errs := make(chan error, n)
+
+	var wg sync.WaitGroup
+
+	wg.Add(n)
+
+	for segment := 0; segment < n; segment++ {
+		go func(segment int) {
+			defer wg.Done()
+
+			s.scanSegment(ctx, segment, n, events, errs)
+		}(segment)
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+		close(errs)
+	}()
+
+	return &segmentedIterator{cancel: cancel, events: events, errs: errs}
+}
+
+// scanSegment reads one segment of a parallel table scan to completion,
+// sending decoded events to events and any error to errs.
+func (s *EventStore) scanSegment(ctx context.Context, segment, totalSegments int, events chan<- eh.Event, errs chan<- error) {
+	input := &dynamodb.ScanInput{
+		TableName:      aws.String(s.TableName(ctx)),
+		Segment:        aws.Int64(int64(segment)),
+		TotalSegments:  aws.Int64(int64(totalSegments)),
+		ConsistentRead: aws.Bool(true),
+	}
+
+	err := s.service.Client().ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var e dbEvent
+			if err := dynamodbattribute.UnmarshalMap(item, &e); err != nil {
+				errs <- &eh.EventStoreError{Err: ErrCouldNotUnmarshalEvent, Op: eh.EventStoreOpLoad}
+
+				return false
+			}
+
+			if e.Version == aggregateVersionRangeKey {
+				continue
+			}
+
+			ev, err := decodeDBEvent(e)
+			if err != nil {
+				errs <- err
+
+				return false
+			}
+
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		errs <- &eh.EventStoreError{Err: err, Op: eh.EventStoreOpLoad}
+	}
+}
+
+// segmentedIterator is the EventIterator returned by iterSegmented.
+type segmentedIterator struct {
+	cancel  context.CancelFunc
+	events  <-chan eh.Event
+	errs    <-chan error
+	current eh.Event
+	err     error
+	done    bool
+}
+
+func (it *segmentedIterator) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+
+	select {
+	case ev, ok := <-it.events:
+		if !ok {
+			select {
+			case err := <-it.errs:
+				it.err = err
+			default:
+			}
+
+			it.finish()
+
+			return false
+		}
+
+		it.current = ev
+
+		return true
+	case err, ok := <-it.errs:
+		if ok {
+			it.err = err
+		}
+
+		it.finish()
+
+		return false
+	case <-ctx.Done():
+		it.err = ctx.Err()
+		it.finish()
+
+		return false
+	}
+}
+
+// finish marks the iterator exhausted and cancels the segments' shared
+// context, so that any segment still blocked sending on events (because
+// Next stopped reading after another segment's error, or the caller's ctx
+// was cancelled) is released instead of leaking its goroutine.
+func (it *segmentedIterator) finish() {
+	it.done = true
+	it.cancel()
+}
+
+func (it *segmentedIterator) Event() eh.Event { return it.current }
+func (it *segmentedIterator) Err() error      { return it.err }
+
+func (it *segmentedIterator) Close() error {
+	it.cancel()
+
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// TestSegmentedIteratorCancelsOnError reproduces the shape of a real
+// iterSegmented run: one segment reports an error while another is blocked
+// sending an event on the shared events channel. Next must cancel the
+// shared context as soon as it observes the error, releasing every segment
+// still blocked on that channel instead of leaking its goroutine until some
+// later Close(). The events channel is never sent to here, so it never
+// competes with errs in Next's select; otherwise which case wins would be
+// an unpredictable race rather than a property of the fix under test.
+func TestSegmentedIteratorCancelsOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+	errs <- errors.New("boom")
+
+	released := make(chan struct{})
+
+	go func() {
+		<-ctx.Done()
+		close(released)
+	}()
+
+	it := &segmentedIterator{cancel: cancel, events: events, errs: errs}
+
+	if it.Next(context.Background()) {
+		t.Fatal("Next should report exhausted once a segment errors")
+	}
+
+	if it.Err() == nil {
+		t.Fatal("Err should return the segment's error")
+	}
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("blocked segment goroutine was not released; shared context was not cancelled")
+	}
+}
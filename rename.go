@@ -0,0 +1,273 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/guregu/dynamo"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// dbRenameCheckpoint is the persisted scan cursor for one segment of a
+// RenameEvent, keyed by the event types being renamed so a resumed rename
+// picks up its own segments' checkpoints and an unrelated rename never
+// collides with them.
+type dbRenameCheckpoint struct {
+	RenameID string `dynamo:",hash"`
+	Segment  int    `dynamo:",range"`
+
+	Done bool
+
+	// LastAggregateID and LastVersion are the key of the last event this
+	// segment renamed, used as the ExclusiveStartKey to resume its scan
+	// without reprocessing already-renamed events.
+	LastAggregateID string
+	LastVersion     int
+
+	Scanned int
+	Renamed int
+}
+
+// renameCheckpointTableName returns the name of the companion table used to
+// persist RenameEvent's per-segment scan cursors for the given namespace's
+// event table.
+func (s *EventStore) renameCheckpointTableName(ctx context.Context) string {
+	if s.config.RenameCheckpointTableName != "" {
+		return s.config.RenameCheckpointTableName
+	}
+
+	return s.TableName(ctx) + "RenameCheckpoints"
+}
+
+// renameID identifies a RenameEvent operation for checkpointing purposes.
+func renameID(from, to eh.EventType) string {
+	return string(from) + "->" + string(to)
+}
+
+// RenameEvent implements the RenameEvent method of the
+// eventhorizon.EventStoreMaintenance interface.
+//
+// The table is scanned in EventStoreConfig.ScanSegments parallel segments (a
+// plain sequential scan if unset), the same knob Iter uses, and matches are
+// renamed in batches of up to maxTransactWriteItems conditional updates per
+// TransactWriteItems call rather than one Update per event. After every
+// batch, the segment's scan position is checkpointed to the companion
+// RenameCheckpoints table, so a rename interrupted partway through a large
+// table resumes from there instead of rescanning from the start.
+// EventStoreConfig.RenameProgress, if set, is called after every batch with
+// the cumulative counts across all segments so far.
+//
+// Each rename writes a MODIFY record to the table's DynamoDB Stream.
+// eventbus/dynamostream recognizes and skips MODIFY records so a rename
+// never gets redelivered to bus handlers as a new event under its new
+// type.
+func (s *EventStore) RenameEvent(ctx context.Context, from, to eh.EventType) error {
+	table, err := s.ensureTable(ctx)
+	if err != nil {
+		return &eh.EventStoreError{
+			Err: err,
+			Op:  eh.EventStoreOpRename,
+		}
+	}
+
+	checkpoints := s.service.Table(s.renameCheckpointTableName(ctx))
+	id := renameID(from, to)
+
+	segments := s.config.ScanSegments
+	if segments < 1 {
+		segments = 1
+	}
+
+	progress := &renameProgressTracker{ctx: ctx, store: s, from: from, to: to}
+
+	var wg sync.WaitGroup
+
+	errs := make([]error, segments)
+
+	wg.Add(segments)
+
+	for segment := 0; segment < segments; segment++ {
+		go func(segment int) {
+			defer wg.Done()
+
+			errs[segment] = s.renameSegment(ctx, table, checkpoints, id, from, to, segment, segments, progress)
+		}(segment)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return &eh.EventStoreError{
+				Err: err,
+				Op:  eh.EventStoreOpRename,
+			}
+		}
+	}
+
+	return nil
+}
+
+// renameProgressTracker accumulates the scanned/renamed counts reported by
+// every segment of a RenameEvent and forwards the running total to
+// EventStoreConfig.RenameProgress, if configured.
+type renameProgressTracker struct {
+	ctx      context.Context
+	store    *EventStore
+	from, to eh.EventType
+
+	mu      sync.Mutex
+	scanned int
+	renamed int
+}
+
+func (p *renameProgressTracker) report(scanned, renamed int) {
+	p.mu.Lock()
+	p.scanned += scanned
+	p.renamed += renamed
+	total, renamedTotal := p.scanned, p.renamed
+	p.mu.Unlock()
+
+	if p.store.config.RenameProgress != nil {
+		p.store.config.RenameProgress(p.ctx, p.from, p.to, total, renamedTotal)
+	}
+}
+
+// renameSegment scans one segment of table for events of type from,
+// checkpointing its progress to checkpoints as it renames matches to to in
+// batches of at most maxTransactWriteItems.
+func (s *EventStore) renameSegment(ctx context.Context, table, checkpoints dynamo.Table, id string, from, to eh.EventType, segment, totalSegments int, progress *renameProgressTracker) error {
+	checkpoint := dbRenameCheckpoint{RenameID: id, Segment: segment}
+
+	err := checkpoints.Get("RenameID", id).Range("Segment", dynamo.Equal, segment).Consistent(true).One(&checkpoint)
+	if err != nil && err != dynamo.ErrNotFound {
+		return err
+	}
+
+	if checkpoint.Done {
+		return nil
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(s.TableName(ctx)),
+		Segment:                   aws.Int64(int64(segment)),
+		TotalSegments:             aws.Int64(int64(totalSegments)),
+		ConsistentRead:            aws.Bool(true),
+		FilterExpression:          aws.String("EventType = :from"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":from": {S: aws.String(string(from))}},
+	}
+
+	if checkpoint.LastAggregateID != "" {
+		input.ExclusiveStartKey = map[string]*dynamodb.AttributeValue{
+			"AggregateID": {S: aws.String(checkpoint.LastAggregateID)},
+			"Version":     {N: aws.String(strconv.Itoa(checkpoint.LastVersion))},
+		}
+	}
+
+	// commit renames a chunk of at most maxTransactWriteItems matches,
+	// advances checkpoint to its last key, persists it and reports
+	// progress. scanned is the number of items DynamoDB examined to
+	// produce this chunk's matches, attributed to the first chunk flushed
+	// for a page.
+	commit := func(matches []dbEvent, scanned int) error {
+		if len(matches) > 0 {
+			if err := s.renameBatch(ctx, table, matches, from, to); err != nil {
+				return err
+			}
+
+			last := matches[len(matches)-1]
+			checkpoint.LastAggregateID = last.AggregateID.String()
+			checkpoint.LastVersion = last.Version
+			checkpoint.Renamed += len(matches)
+		}
+
+		checkpoint.Scanned += scanned
+
+		progress.report(scanned, len(matches))
+
+		return checkpoints.Put(&checkpoint).Run()
+	}
+
+	var scanErr error
+
+	err = s.service.Client().ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		matches := make([]dbEvent, 0, len(page.Items))
+
+		for _, item := range page.Items {
+			var e dbEvent
+			if err := dynamodbattribute.UnmarshalMap(item, &e); err != nil {
+				scanErr = &eh.EventStoreError{Err: ErrCouldNotUnmarshalEvent, Op: eh.EventStoreOpRename}
+
+				return false
+			}
+
+			matches = append(matches, e)
+		}
+
+		scanned := int(aws.Int64Value(page.ScannedCount))
+
+		for len(matches) > maxTransactWriteItems {
+			if err := commit(matches[:maxTransactWriteItems], scanned); err != nil {
+				scanErr = err
+
+				return false
+			}
+
+			matches, scanned = matches[maxTransactWriteItems:], 0
+		}
+
+		if err := commit(matches, scanned); err != nil {
+			scanErr = err
+
+			return false
+		}
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if scanErr != nil {
+		return scanErr
+	}
+
+	checkpoint.Done = true
+
+	return checkpoints.Put(&checkpoint).Run()
+}
+
+// renameBatch commits a single TransactWriteItems call that conditionally
+// renames every event in events from from to to, mirroring the batching
+// writeEvents uses for Save.
+func (s *EventStore) renameBatch(ctx context.Context, table dynamo.Table, events []dbEvent, from, to eh.EventType) error {
+	tx := s.service.WriteTx()
+
+	for _, e := range events {
+		tx.Update(table.Update("AggregateID", e.AggregateID).Range("Version", e.Version).If("EventType = ?", from).Set("EventType", to))
+	}
+
+	if err := tx.RunWithContext(ctx); err != nil {
+		return translateTransactWriteError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore"
+)
+
+// TestRenameEventIntegration runs the shared eventhorizon maintenance
+// acceptance suite, which exercises RenameEvent alongside Replace, against
+// a real DynamoDB Local instance.
+func TestRenameEventIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:8000"
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	table := "test-events-" + hex.EncodeToString(b)
+
+	store, err := NewEventStore(&EventStoreConfig{
+		TableName: table,
+		Region:    "us-east-1",
+		Endpoint:  endpoint,
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	defer func() {
+		if err := store.DeleteTable(ctx); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}()
+
+	eventstore.MaintenanceAcceptanceTest(t, store, store, ctx)
+}
+
+// fakeRenameClient backs a single segment's scan of the events table plus
+// its checkpoint row, letting a scan be interrupted after one page commits
+// without a real DynamoDB. pages are returned one per ScanPagesWithContext
+// call; crashAfter, if it matches the 1-based call number, makes that call
+// report an error after invoking the callback, simulating the process
+// dying after that page's batch (and checkpoint) was already committed but
+// before the scan moved on or was marked done.
+type fakeRenameClient struct {
+	dynamodbiface.DynamoDBAPI
+
+	pages      []*dynamodb.ScanOutput
+	crashAfter int
+
+	scanCalls   []*dynamodb.ScanInput
+	renamed     []string
+	checkpoint  map[string]*dynamodb.AttributeValue
+	checkpoints []dbRenameCheckpoint
+}
+
+func (f *fakeRenameClient) GetItemWithContext(_ aws.Context, _ *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.checkpoint}, nil
+}
+
+func (f *fakeRenameClient) PutItemWithContext(_ aws.Context, in *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	f.checkpoint = in.Item
+
+	var cp dbRenameCheckpoint
+	if err := dynamodbattribute.UnmarshalMap(in.Item, &cp); err != nil {
+		return nil, err
+	}
+	f.checkpoints = append(f.checkpoints, cp)
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeRenameClient) TransactWriteItems(in *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	for _, item := range in.TransactItems {
+		if item.Update == nil {
+			continue
+		}
+		f.renamed = append(f.renamed, aws.StringValue(item.Update.Key["AggregateID"].S)+"@"+aws.StringValue(item.Update.Key["Version"].N))
+	}
+
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (f *fakeRenameClient) ScanPagesWithContext(_ aws.Context, in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, _ ...request.Option) error {
+	f.scanCalls = append(f.scanCalls, in)
+	call := len(f.scanCalls)
+
+	page := f.pages[call-1]
+	fn(page, call == len(f.pages))
+
+	if call == f.crashAfter {
+		return errors.New("connection reset (simulated crash)")
+	}
+
+	return nil
+}
+
+func renameMatchItem(t *testing.T, id uuid.UUID, version int, eventType eh.EventType) map[string]*dynamodb.AttributeValue {
+	t.Helper()
+
+	item, err := dynamodbattribute.MarshalMap(dbEvent{AggregateID: id, Version: version, EventType: eventType})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	return item
+}
+
+// TestRenameEventResumesAfterInterruption simulates a RenameEvent whose
+// single segment is interrupted right after its first page's batch (and
+// checkpoint) have committed. A second, resumed RenameEvent call must pick
+// up from that checkpoint: it should neither reprocess the first page's
+// event nor rename it a second time.
+func TestRenameEventResumesAfterInterruption(t *testing.T) {
+	from, to := eh.EventType("Old"), eh.EventType("New")
+	id1, id2 := uuid.New(), uuid.New()
+
+	fake := &fakeRenameClient{
+		pages: []*dynamodb.ScanOutput{
+			{Items: []map[string]*dynamodb.AttributeValue{renameMatchItem(t, id1, 1, from)}, ScannedCount: aws.Int64(1)},
+		},
+		crashAfter: 1,
+	}
+
+	s := NewEventStoreWithDB(&EventStoreConfig{TableName: "events", ScanSegments: 1}, dynamo.NewFromIface(fake))
+
+	if err := s.RenameEvent(context.Background(), from, to); err == nil {
+		t.Fatal("RenameEvent should report the simulated crash")
+	}
+
+	if got, want := fake.renamed, []string{id1.String() + "@1"}; len(got) != len(want) || got[0] != want[0] {
+		t.Fatalf("after the interrupted run, renamed = %v, want %v", got, want)
+	}
+
+	if len(fake.checkpoints) != 1 || fake.checkpoints[0].Done {
+		t.Fatalf("checkpoint after the interrupted run = %+v, want one not-done checkpoint", fake.checkpoints)
+	}
+
+	// Resume: the second page picks up where the first left off.
+	fake.pages = append(fake.pages, &dynamodb.ScanOutput{
+		Items:        []map[string]*dynamodb.AttributeValue{renameMatchItem(t, id2, 1, from)},
+		ScannedCount: aws.Int64(1),
+	})
+	fake.crashAfter = 0
+
+	if err := s.RenameEvent(context.Background(), from, to); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	resumedScan := fake.scanCalls[len(fake.scanCalls)-1]
+	if resumedScan.ExclusiveStartKey == nil {
+		t.Fatal("the resumed scan should start from the interrupted segment's checkpoint, not from the beginning")
+	}
+	if got := aws.StringValue(resumedScan.ExclusiveStartKey["AggregateID"].S); got != id1.String() {
+		t.Errorf("resumed scan's ExclusiveStartKey AggregateID = %q, want %q (the last item the interrupted run committed)", got, id1.String())
+	}
+
+	want := []string{id1.String() + "@1", id2.String() + "@1"}
+	if len(fake.renamed) != len(want) || fake.renamed[0] != want[0] || fake.renamed[1] != want[1] {
+		t.Fatalf("renamed across both runs = %v, want %v (id1 must not be renamed twice)", fake.renamed, want)
+	}
+
+	last := fake.checkpoints[len(fake.checkpoints)-1]
+	if !last.Done {
+		t.Error("the checkpoint should be marked done once the resumed run finishes the scan")
+	}
+}
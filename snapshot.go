@@ -0,0 +1,220 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrNoSnapshot is returned by LoadSnapshot when no snapshot exists for an
+// aggregate.
+var ErrNoSnapshot = errors.New("no snapshot found")
+
+// ErrCouldNotSaveSnapshot is when a snapshot could not be saved.
+var ErrCouldNotSaveSnapshot = errors.New("could not save snapshot")
+
+// Snapshot is a marshaled, point-in-time representation of an aggregate's
+// state at a specific version. The State field is opaque to the event
+// store; it is produced and consumed by the Snapshotter configured on the
+// EventStore.
+type Snapshot struct {
+	AggregateID   uuid.UUID
+	AggregateType eh.AggregateType
+	Version       int
+	Timestamp     time.Time
+	State         []byte
+}
+
+// Snapshotter marshals the current state of an aggregate into a raw
+// snapshot payload. It is called by Save when the configured
+// SnapshotStrategy decides that a snapshot should be written, since the
+// event store itself only ever sees the events being appended, not the
+// aggregate.
+type Snapshotter func(ctx context.Context, aggregateType eh.AggregateType, id uuid.UUID, version int) ([]byte, error)
+
+// SnapshotStrategy decides whether a new snapshot should be written for an
+// aggregate as part of a Save call.
+type SnapshotStrategy interface {
+	// ShouldSnapshot is consulted after events have been appended for an
+	// aggregate. lastSnapshot is the most recently stored snapshot for the
+	// aggregate, or nil if none has been taken yet. newVersion is the
+	// version of the aggregate after the events in this Save have been
+	// applied.
+	ShouldSnapshot(lastSnapshot *Snapshot, newVersion int) bool
+}
+
+// everyNEventsStrategy is a SnapshotStrategy that snapshots once at least n
+// events have accumulated since the last snapshot.
+type everyNEventsStrategy struct {
+	n int
+}
+
+// NewEveryNEventsStrategy returns a SnapshotStrategy that snapshots an
+// aggregate every n events.
+func NewEveryNEventsStrategy(n int) SnapshotStrategy {
+	return &everyNEventsStrategy{n: n}
+}
+
+func (s *everyNEventsStrategy) ShouldSnapshot(lastSnapshot *Snapshot, newVersion int) bool {
+	lastVersion := 0
+	if lastSnapshot != nil {
+		lastVersion = lastSnapshot.Version
+	}
+
+	return newVersion-lastVersion >= s.n
+}
+
+// timeBasedStrategy is a SnapshotStrategy that snapshots at most once per
+// interval.
+type timeBasedStrategy struct {
+	interval time.Duration
+}
+
+// NewTimeBasedStrategy returns a SnapshotStrategy that snapshots an
+// aggregate once interval has passed since the last snapshot.
+func NewTimeBasedStrategy(interval time.Duration) SnapshotStrategy {
+	return &timeBasedStrategy{interval: interval}
+}
+
+func (s *timeBasedStrategy) ShouldSnapshot(lastSnapshot *Snapshot, newVersion int) bool {
+	if lastSnapshot == nil {
+		return true
+	}
+
+	return time.Since(lastSnapshot.Timestamp) >= s.interval
+}
+
+// dbSnapshot is the internal snapshot record for the DynamoDB event store,
+// stored in a companion table so its Version range key can stay a plain
+// number without disturbing the events table's key schema.
+type dbSnapshot struct {
+	AggregateID uuid.UUID `dynamo:",hash"`
+	Version     int       `dynamo:",range"`
+
+	AggregateType eh.AggregateType
+	Timestamp     time.Time
+	RawState      []byte
+}
+
+// snapshotTableName returns the name of the companion table used to store
+// snapshots for the given namespace's event table.
+func (s *EventStore) snapshotTableName(ctx context.Context) string {
+	if s.config.SnapshotTableName != "" {
+		return s.config.SnapshotTableName
+	}
+
+	return s.TableName(ctx) + "Snapshots"
+}
+
+// LoadSnapshot loads the latest snapshot for the aggregate with id, if any.
+// It returns ErrNoSnapshot if no snapshot has been taken yet.
+func (s *EventStore) LoadSnapshot(ctx context.Context, id uuid.UUID) (*Snapshot, error) {
+	table := s.service.Table(s.snapshotTableName(ctx))
+
+	var snap dbSnapshot
+	err := table.Get("AggregateID", id.String()).Order(dynamo.Descending).Limit(1).Consistent(true).One(&snap)
+	if err == dynamo.ErrNotFound {
+		return nil, ErrNoSnapshot
+	} else if err, ok := err.(awserr.RequestFailure); ok && err.Code() == "ResourceNotFoundException" {
+		return nil, ErrNoSnapshot
+	} else if err != nil {
+		return nil, &eh.EventStoreError{
+			Err:         err,
+			Op:          eh.EventStoreOpLoad,
+			AggregateID: id,
+		}
+	}
+
+	return &Snapshot{
+		AggregateID:   uuid.UUID(snap.AggregateID),
+		AggregateType: snap.AggregateType,
+		Version:       snap.Version,
+		Timestamp:     snap.Timestamp,
+		State:         snap.RawState,
+	}, nil
+}
+
+// SaveSnapshot stores snapshot in the companion snapshot table, keyed by
+// aggregate ID and version so the full snapshot history is retained and
+// LoadSnapshot can always return the latest one.
+func (s *EventStore) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	table := s.service.Table(s.snapshotTableName(ctx))
+
+	snap := &dbSnapshot{
+		AggregateID:   snapshot.AggregateID,
+		Version:       snapshot.Version,
+		AggregateType: snapshot.AggregateType,
+		Timestamp:     snapshot.Timestamp,
+		RawState:      snapshot.State,
+	}
+
+	if err := table.Put(snap).Run(); err != nil {
+		return &eh.EventStoreError{
+			Err:         ErrCouldNotSaveSnapshot,
+			Op:          eh.EventStoreOpSave,
+			AggregateID: snapshot.AggregateID,
+		}
+	}
+
+	return nil
+}
+
+// maybeSnapshot consults the configured SnapshotStrategy and, if it fires,
+// uses the configured Snapshotter to capture and store a new snapshot for
+// the aggregate at newVersion. It is called by Save once the events for a
+// request have been committed, so the snapshot always reflects a version
+// that has actually been persisted.
+//
+// A failure to snapshot is deliberately not surfaced as a Save error: the
+// events are already durable, and the next Save (or strategy tick) will
+// simply try again.
+func (s *EventStore) maybeSnapshot(ctx context.Context, at eh.AggregateType, id uuid.UUID, newVersion int) {
+	if s.config.SnapshotStrategy == nil || s.config.Snapshotter == nil {
+		return
+	}
+
+	lastSnapshot, err := s.LoadSnapshot(ctx, id)
+	if err != nil && !errors.Is(err, ErrNoSnapshot) {
+		return
+	}
+
+	if errors.Is(err, ErrNoSnapshot) {
+		lastSnapshot = nil
+	}
+
+	if !s.config.SnapshotStrategy.ShouldSnapshot(lastSnapshot, newVersion) {
+		return
+	}
+
+	state, err := s.config.Snapshotter(ctx, at, id, newVersion)
+	if err != nil {
+		return
+	}
+
+	_ = s.SaveSnapshot(ctx, Snapshot{
+		AggregateID:   id,
+		AggregateType: at,
+		Version:       newVersion,
+		Timestamp:     time.Now(),
+		State:         state,
+	})
+}
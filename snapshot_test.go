@@ -0,0 +1,60 @@
+// Copyright (c) 2018 - The Event Horizon DynamoDB authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEveryNEventsStrategyShouldSnapshot(t *testing.T) {
+	strategy := NewEveryNEventsStrategy(10)
+
+	if strategy.ShouldSnapshot(nil, 9) {
+		t.Error("should not snapshot before n events have accumulated")
+	}
+
+	if !strategy.ShouldSnapshot(nil, 10) {
+		t.Error("should snapshot once n events have accumulated with no prior snapshot")
+	}
+
+	last := &Snapshot{Version: 10}
+
+	if strategy.ShouldSnapshot(last, 19) {
+		t.Error("should not snapshot before another n events have accumulated since the last snapshot")
+	}
+
+	if !strategy.ShouldSnapshot(last, 20) {
+		t.Error("should snapshot once another n events have accumulated since the last snapshot")
+	}
+}
+
+func TestTimeBasedStrategyShouldSnapshot(t *testing.T) {
+	strategy := NewTimeBasedStrategy(time.Hour)
+
+	if !strategy.ShouldSnapshot(nil, 1) {
+		t.Error("should snapshot immediately when no snapshot has been taken yet")
+	}
+
+	recent := &Snapshot{Version: 1, Timestamp: time.Now()}
+	if strategy.ShouldSnapshot(recent, 2) {
+		t.Error("should not snapshot before the interval has passed since the last snapshot")
+	}
+
+	stale := &Snapshot{Version: 1, Timestamp: time.Now().Add(-2 * time.Hour)}
+	if !strategy.ShouldSnapshot(stale, 2) {
+		t.Error("should snapshot once the interval has passed since the last snapshot")
+	}
+}